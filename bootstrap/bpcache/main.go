@@ -0,0 +1,163 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bpcache wraps a PrimaryBuilderInvocation marked cacheable: it hashes the
+// invocation's declared CacheKeyInputs, and if that hash has already been
+// populated under CacheDir, copies the cached outputs into place instead of
+// re-running the (expensive) wrapped command.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+type stringList []string
+
+func (l *stringList) String() string     { return fmt.Sprint([]string(*l)) }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+var (
+	cacheDir  string
+	outputs   stringList
+	keyInputs stringList
+)
+
+func init() {
+	flag.StringVar(&cacheDir, "cache_dir", "", "directory holding cached outputs, keyed by content hash")
+	flag.Var(&outputs, "output", "an output file of the wrapped command to cache (may be repeated)")
+	flag.Var(&keyInputs, "key_input", "a file to hash into the cache key (may be repeated)")
+}
+
+func main() {
+	flag.Parse()
+	command := flag.Args()
+
+	if cacheDir == "" || len(outputs) == 0 || len(command) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: bpcache -cache_dir DIR -output FILE [-output FILE ...] "+
+			"-key_input FILE [-key_input FILE ...] -- command [args...]")
+		os.Exit(1)
+	}
+
+	key, err := hashInputs(keyInputs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error hashing cache key inputs: %s\n", err)
+		os.Exit(1)
+	}
+
+	entryDir := filepath.Join(cacheDir, key)
+
+	if restoreFromCache(entryDir, outputs) {
+		return
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error running %v: %s\n", command, err)
+		os.Exit(1)
+	}
+
+	if err := populateCache(entryDir, outputs); err != nil {
+		fmt.Fprintf(os.Stderr, "error populating cache %s: %s\n", entryDir, err)
+		os.Exit(1)
+	}
+}
+
+func hashInputs(inputs []string) (string, error) {
+	h := sha256.New()
+	for _, input := range inputs {
+		f, err := os.Open(input)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// restoreFromCache copies every output from entryDir into place, returning
+// false (without copying anything) if entryDir doesn't hold a complete set.
+func restoreFromCache(entryDir string, outputs []string) bool {
+	for _, output := range outputs {
+		if _, err := os.Stat(filepath.Join(entryDir, cacheEntryName(output))); err != nil {
+			return false
+		}
+	}
+
+	for _, output := range outputs {
+		if err := copyFile(filepath.Join(entryDir, cacheEntryName(output)), output); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func populateCache(entryDir string, outputs []string) error {
+	if err := os.MkdirAll(entryDir, 0777); err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		if err := copyFile(output, filepath.Join(entryDir, cacheEntryName(output))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cacheEntryName returns the name an output is stored under inside a cache
+// entry directory. It hashes the output's full cleaned path rather than
+// using filepath.Base, so two outputs that share a basename but live in
+// different directories -- e.g. two stages of a multi-stage
+// PrimaryBuilderInvocation DAG each producing their own build.ninja -- don't
+// collide and overwrite one another.
+func cacheEntryName(output string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(output)))
+	return hex.EncodeToString(sum[:])
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
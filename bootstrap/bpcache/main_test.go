@@ -0,0 +1,140 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashInputs(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.txt")
+
+	if err := os.WriteFile(input, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	hash1, err := hashInputs([]string{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(input, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	hash2, err := hashInputs([]string{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash1 != hash2 {
+		t.Errorf("hashInputs() = %q, %q, want identical hashes for identical content", hash1, hash2)
+	}
+
+	if err := os.WriteFile(input, []byte("world"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	hash3, err := hashInputs([]string{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash1 == hash3 {
+		t.Errorf("hashInputs() = %q, want a different hash after the input changed", hash3)
+	}
+}
+
+func TestRestoreAndPopulateCacheSharedBasename(t *testing.T) {
+	dir := t.TempDir()
+	entryDir := filepath.Join(dir, "cache", "abc123")
+	outputA := filepath.Join(dir, "a", "build.ninja")
+	outputB := filepath.Join(dir, "b", "build.ninja")
+
+	for path, contents := range map[string]string{outputA: "a contents", outputB: "b contents"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := populateCache(entryDir, []string{outputA, outputB}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(outputA); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(outputB); err != nil {
+		t.Fatal(err)
+	}
+
+	if !restoreFromCache(entryDir, []string{outputA, outputB}) {
+		t.Fatal("restoreFromCache() = false, want true once the cache entry is populated")
+	}
+
+	gotA, err := os.ReadFile(outputA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotA) != "a contents" {
+		t.Errorf("restored %s = %q, want %q", outputA, gotA, "a contents")
+	}
+
+	gotB, err := os.ReadFile(outputB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotB) != "b contents" {
+		t.Errorf("restored %s = %q, want %q", outputB, gotB, "b contents")
+	}
+}
+
+func TestRestoreAndPopulateCache(t *testing.T) {
+	dir := t.TempDir()
+	entryDir := filepath.Join(dir, "cache", "abc123")
+	output := filepath.Join(dir, "out", "build.ninja")
+
+	if err := os.MkdirAll(filepath.Dir(output), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte("ninja contents"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if restoreFromCache(entryDir, []string{output}) {
+		t.Fatal("restoreFromCache() = true, want false for an empty cache entry")
+	}
+
+	if err := populateCache(entryDir, []string{output}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !restoreFromCache(entryDir, []string{output}) {
+		t.Fatal("restoreFromCache() = false, want true once the cache entry is populated")
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ninja contents" {
+		t.Errorf("restored output = %q, want %q", got, "ninja contents")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bpglob is run as a Ninja build statement for each glob a primary builder
+// performed. It re-expands the glob and only rewrites (touches) its stamp
+// file when the resulting file list has changed, so that Ninja -- not a
+// re-run of the primary builder -- decides whether anything downstream of
+// the glob needs to be regenerated.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type excludeFlags []string
+
+func (e *excludeFlags) String() string {
+	return strings.Join(*e, " ")
+}
+
+func (e *excludeFlags) Set(s string) error {
+	*e = append(*e, s)
+	return nil
+}
+
+var (
+	out      string
+	dir      string
+	excludes excludeFlags
+)
+
+func init() {
+	flag.StringVar(&out, "o", "", "stamp file to write")
+	flag.StringVar(&dir, "d", "", "directory to resolve the pattern relative to")
+	flag.Var(&excludes, "e", "pattern to exclude from the result (may be repeated)")
+}
+
+func main() {
+	flag.Parse()
+
+	if out == "" {
+		fmt.Fprintln(os.Stderr, "error: -o <stampfile> is required")
+		os.Exit(1)
+	}
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "error: exactly one glob pattern argument is required")
+		os.Exit(1)
+	}
+	pattern := flag.Arg(0)
+	root := dir
+	if root == "" {
+		root = "."
+	}
+
+	files, dirs, err := globPattern(root, pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: bad glob pattern %q: %s\n", pattern, err)
+		os.Exit(1)
+	}
+
+	files = excludeFiles(files, excludes)
+
+	if err := writeStampIfChanged(out, files); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %s: %s\n", out, err)
+		os.Exit(1)
+	}
+
+	// Ninja's deps=gcc mode reads this depfile on the next build to decide
+	// whether to re-invoke bpglob at all -- without it, once the stamp
+	// exists, nothing ever tells Ninja that a file was added or removed
+	// under the glob's directories.
+	if err := writeDepFile(out, dirs); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing depfile for %s: %s\n", out, err)
+		os.Exit(1)
+	}
+}
+
+// writeStampIfChanged writes the sorted, newline-joined file list to out,
+// unless it already holds exactly that content -- in which case it's left
+// untouched so Ninja considers out (and anything depending on it) up to
+// date.
+func writeStampIfChanged(out string, files []string) error {
+	sort.Strings(files)
+	newContents := strings.Join(files, "\n") + "\n"
+
+	if oldContents, err := ioutil.ReadFile(out); err == nil && string(oldContents) == newContents {
+		return nil
+	}
+
+	return ioutil.WriteFile(out, []byte(newContents), 0666)
+}
+
+// globPattern matches pattern against the tree rooted at root, the same way
+// Blueprint's own glob engine does: a "**" path segment matches zero or more
+// directories, not the single literal segment filepath.Glob would treat it
+// as. It returns the matched files, sorted, together with every directory
+// it had to read to evaluate the pattern, so a caller can depend on those
+// directories to notice additions and removals.
+func globPattern(root, pattern string) (files []string, dirs []string, err error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	visited := map[string]bool{}
+	matches, err := globSegments(root, segments, visited)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for d := range visited {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(matches)
+	sort.Strings(dirs)
+	return matches, dirs, nil
+}
+
+func globSegments(dir string, segments []string, visited map[string]bool) ([]string, error) {
+	if len(segments) == 0 {
+		return []string{dir}, nil
+	}
+
+	seg, rest := segments[0], segments[1:]
+
+	if seg == "**" {
+		visited[dir] = true
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		// "**" matches zero directories too, so the rest of the pattern is
+		// also tried directly against this directory's own entries.
+		matches, err := globSegments(dir, rest, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			sub, err := globSegments(filepath.Join(dir, entry.Name()), segments, visited)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, sub...)
+		}
+		return matches, nil
+	}
+
+	visited[dir] = true
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		matched, err := filepath.Match(seg, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		sub, err := globSegments(filepath.Join(dir, entry.Name()), rest, visited)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, sub...)
+	}
+	return matches, nil
+}
+
+// writeDepFile records dirs as the prerequisites of out in a Ninja
+// deps=gcc-style depfile, so Ninja reruns the bpglob build edge whenever one
+// of them changes (e.g. a file is added or removed) instead of only when out
+// itself is missing.
+func writeDepFile(out string, dirs []string) error {
+	escaped := make([]string, len(dirs))
+	for i, d := range dirs {
+		escaped[i] = strings.ReplaceAll(d, " ", "\\ ")
+	}
+	content := fmt.Sprintf("%s: %s\n", out, strings.Join(escaped, " "))
+	return ioutil.WriteFile(out+".d", []byte(content), 0666)
+}
+
+func excludeFiles(files []string, excludes []string) []string {
+	if len(excludes) == 0 {
+		return files
+	}
+
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		excluded := false
+		for _, e := range excludes {
+			if matched, _ := filepath.Match(e, f); matched {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			result = append(result, f)
+		}
+	}
+	return result
+}
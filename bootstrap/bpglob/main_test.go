@@ -0,0 +1,133 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExcludeFiles(t *testing.T) {
+	files := []string{"a.go", "a_test.go", "b.go", "b_test.go"}
+
+	got := excludeFiles(files, []string{"*_test.go"})
+
+	want := []string{"a.go", "b.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("excludeFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestExcludeFilesNoExcludes(t *testing.T) {
+	files := []string{"a.go", "b.go"}
+
+	got := excludeFiles(files, nil)
+
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("excludeFiles() = %v, want unchanged %v", got, files)
+	}
+}
+
+func TestGlobPatternRecursive(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{"a.go", "sub/b.go", "sub/nested/c.go", "sub/nested/d.txt"} {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, dirs, err := globPattern(root, "**/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		filepath.Join(root, "a.go"),
+		filepath.Join(root, "sub/b.go"),
+		filepath.Join(root, "sub/nested/c.go"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("globPattern() files = %v, want %v", files, want)
+	}
+
+	wantDirs := []string{
+		root,
+		filepath.Join(root, "sub"),
+		filepath.Join(root, "sub/nested"),
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("globPattern() dirs = %v, want %v", dirs, wantDirs)
+	}
+}
+
+func TestWriteDepFile(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "stamp")
+
+	if err := writeDepFile(out, []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(out + ".d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%s: %s %s\n", out, filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+	if string(got) != want {
+		t.Errorf("depfile contents = %q, want %q", got, want)
+	}
+}
+
+func TestWriteStampIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	stamp := filepath.Join(dir, "stamp")
+
+	if err := writeStampIfChanged(stamp, []string{"b.go", "a.go"}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.Stat(stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeStampIfChanged(stamp, []string{"a.go", "b.go"}); err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.Stat(stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ModTime() != second.ModTime() {
+		t.Errorf("stamp was rewritten for an unchanged (if differently ordered) file list")
+	}
+
+	if err := writeStampIfChanged(stamp, []string{"a.go", "b.go", "c.go"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a.go\nb.go\nc.go\n" {
+		t.Errorf("stamp contents = %q, want %q", got, "a.go\nb.go\nc.go\n")
+	}
+}
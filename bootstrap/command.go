@@ -16,9 +16,14 @@ package bootstrap
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	httppprof "net/http/pprof"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -27,20 +32,38 @@ import (
 	"runtime/trace"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/bootstrap/bpdoc"
+	"github.com/google/blueprint/bootstrap/glob"
 )
 
 type Args struct {
-	OutFile                  string
-	Subninjas                []string
-	GlobFile                 string
-	GlobListDir              string
-	DepFile                  string
-	DocFile                  string
-	Cpuprofile               string
-	Memprofile               string
-	DelveListen              string
-	DelvePath                string
-	TraceFile                string
+	OutFile             string
+	Subninjas           []string
+	BuildGlobsNinjaFile string
+	// BpglobCmd is the path to the built bpglob binary, referenced by the
+	// bpglob rule written to BuildGlobsNinjaFile.
+	BpglobCmd string
+	DepFile   string
+	DocFile   string
+
+	Cpuprofile       string
+	Memprofile       string
+	BlockProfile     string
+	MutexProfile     string
+	GoroutineProfile string
+	// PProfListen, if set (e.g. "localhost:6060"), starts a net/http/pprof
+	// server on that address for the lifetime of the run, so a long-running
+	// invocation can be inspected live.
+	PProfListen string
+	DelveListen string
+	DelvePath   string
+	TraceFile   string
+	// TraceRegions additionally wraps the major phases (parsing, dependency
+	// resolution, build action preparation, and writing the Ninja file) in
+	// runtime/trace regions, so TraceFile is navigable by phase instead of
+	// one opaque blob.
+	TraceRegions bool
+
 	RunGoTests               bool
 	UseValidations           bool
 	NoGC                     bool
@@ -51,9 +74,169 @@ type Args struct {
 	TopFile                  string
 	GeneratingPrimaryBuilder bool
 
+	// ErrorFormat selects how fatal errors are reported: "text" (the
+	// default, ANSI-colored text on stdout), "json" (one object per error
+	// on stderr, for editors and CI dashboards), or "github-actions" (the
+	// GitHub Actions `::error ...` workflow-command form).
+	ErrorFormat string
+	// ErrorLogFile, if set, additionally writes the structured error
+	// stream to a file regardless of ErrorFormat, so the pretty version
+	// can still go to the terminal.
+	ErrorLogFile string
+
 	PrimaryBuilderInvocations []PrimaryBuilderInvocation
 }
 
+const (
+	ErrorFormatText          = "text"
+	ErrorFormatJSON          = "json"
+	ErrorFormatGithubActions = "github-actions"
+)
+
+// PrimaryBuilderInvocation describes a single invocation of a primary
+// builder (e.g. Soong) as a Ninja build statement: Inputs and Outputs are
+// its declared inputs/outputs, and Args are the command-line arguments it's
+// invoked with. Unless Command is set, the Ninja-edge emission runs Args
+// against the fixed primary builder binary ($primaryBuilderCmd); Command,
+// when non-empty, is the full command line (binary plus arguments) to run
+// instead, and must be honored by that same emission code.
+//
+// A multi-stage build (bootstrap -> primary -> main) is expressed by giving
+// each stage's invocation a Name and listing the Names of the invocations it
+// must run after in Deps; RunBlueprint resolves those into OrderOnlyInputs,
+// which the Ninja-edge emission adds to the build statement as order-only
+// ("||") dependencies on the predecessors' Outputs. If CacheDir and
+// CacheKeyInputs are both set, Command is rewritten to run the invocation
+// through the bpcache helper, which hashes CacheKeyInputs and skips the real
+// command (restoring its Outputs instead) whenever that hash is already
+// cached.
+type PrimaryBuilderInvocation struct {
+	Inputs  []string
+	Outputs []string
+	Args    []string
+
+	// Command, when set, overrides the default "$primaryBuilderCmd $Args"
+	// Ninja command line for this invocation with a full command (binary
+	// plus arguments) of its own.
+	Command []string
+
+	Name string
+	Deps []string
+
+	CacheKeyInputs []string
+	CacheDir       string
+
+	// OrderOnlyInputs is populated by resolvePrimaryBuilderInvocationDeps
+	// from Deps, and must be added as order-only ("||") Ninja dependencies
+	// by whatever code emits this invocation's build statement.
+	OrderOnlyInputs []string
+}
+
+// sortPrimaryBuilderInvocations topologically sorts invocations by Deps so
+// that every invocation appears after the invocations it depends on. It
+// fatals on an unknown dependency name or a dependency cycle.
+func sortPrimaryBuilderInvocations(invocations []PrimaryBuilderInvocation) []PrimaryBuilderInvocation {
+	byName := make(map[string]PrimaryBuilderInvocation, len(invocations))
+	for _, invocation := range invocations {
+		if invocation.Name != "" {
+			byName[invocation.Name] = invocation
+		}
+	}
+
+	var sorted []PrimaryBuilderInvocation
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(invocation PrimaryBuilderInvocation)
+	visit = func(invocation PrimaryBuilderInvocation) {
+		if invocation.Name != "" {
+			if visited[invocation.Name] {
+				return
+			}
+			if visiting[invocation.Name] {
+				fatalf("primary builder invocation dependency cycle involving %q", invocation.Name)
+			}
+			visiting[invocation.Name] = true
+		}
+
+		for _, dep := range invocation.Deps {
+			depInvocation, ok := byName[dep]
+			if !ok {
+				fatalf("primary builder invocation %q depends on unknown invocation %q",
+					invocation.Name, dep)
+			}
+			visit(depInvocation)
+		}
+
+		if invocation.Name != "" {
+			visiting[invocation.Name] = false
+			visited[invocation.Name] = true
+		}
+		sorted = append(sorted, invocation)
+	}
+
+	for _, invocation := range invocations {
+		visit(invocation)
+	}
+
+	return sorted
+}
+
+// resolvePrimaryBuilderInvocationDeps turns each invocation's Deps (names of
+// predecessor invocations) into order-only dependencies on those
+// predecessors' declared Outputs.
+func resolvePrimaryBuilderInvocationDeps(invocations []PrimaryBuilderInvocation) []PrimaryBuilderInvocation {
+	outputsByName := make(map[string][]string, len(invocations))
+	for _, invocation := range invocations {
+		if invocation.Name != "" {
+			outputsByName[invocation.Name] = invocation.Outputs
+		}
+	}
+
+	for i, invocation := range invocations {
+		for _, dep := range invocation.Deps {
+			invocations[i].OrderOnlyInputs = append(invocations[i].OrderOnlyInputs, outputsByName[dep]...)
+		}
+	}
+
+	return invocations
+}
+
+// wrapCacheablePrimaryBuilderInvocation, when CacheDir and CacheKeyInputs
+// are both set, rewrites an invocation's Command to run the real command
+// (Command if set, otherwise the fixed primary builder plus Args) through
+// the bpcache helper instead:
+// bpcache hashes CacheKeyInputs, and only runs the wrapped command if that
+// hash isn't already populated under CacheDir.
+//
+// Args is left untouched -- it still holds only the primary builder's own
+// flags, since it's Command, not Args, that the Ninja-edge emission execs.
+func wrapCacheablePrimaryBuilderInvocation(invocation PrimaryBuilderInvocation) PrimaryBuilderInvocation {
+	if invocation.CacheDir == "" || len(invocation.CacheKeyInputs) == 0 {
+		return invocation
+	}
+
+	command := invocation.Command
+	if command == nil {
+		command = append([]string{"$primaryBuilderCmd"}, invocation.Args...)
+	}
+
+	bpcacheArgs := []string{"bpcache", "-cache_dir", invocation.CacheDir}
+	for _, output := range invocation.Outputs {
+		bpcacheArgs = append(bpcacheArgs, "-output", output)
+	}
+	for _, input := range invocation.CacheKeyInputs {
+		bpcacheArgs = append(bpcacheArgs, "-key_input", input)
+	}
+	bpcacheArgs = append(bpcacheArgs, "--")
+	bpcacheArgs = append(bpcacheArgs, command...)
+
+	invocation.Command = bpcacheArgs
+	invocation.Inputs = append(append([]string{}, invocation.Inputs...), invocation.CacheKeyInputs...)
+
+	return invocation
+}
+
 func PrimaryBuilderExtraFlags(args Args, mainNinjaFile string) []string {
 	result := make([]string, 0)
 
@@ -76,6 +259,14 @@ func PrimaryBuilderExtraFlags(args Args, mainNinjaFile string) []string {
 		result = append(result, "--delve_path", args.DelvePath)
 	}
 
+	if args.ErrorFormat != "" {
+		result = append(result, "--error_format", args.ErrorFormat)
+	}
+
+	if args.ErrorLogFile != "" {
+		result = append(result, "--error_log", args.ErrorLogFile)
+	}
+
 	return result
 }
 
@@ -85,6 +276,8 @@ func PrimaryBuilderExtraFlags(args Args, mainNinjaFile string) []string {
 func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []string {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	initErrorReporting(ctx, args)
+
 	if args.NoGC {
 		debug.SetGCPercent(-1)
 	}
@@ -109,6 +302,29 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 		defer trace.Stop()
 	}
 
+	if args.BlockProfile != "" {
+		runtime.SetBlockProfileRate(1)
+	}
+
+	if args.MutexProfile != "" {
+		runtime.SetMutexProfileFraction(1)
+	}
+
+	if args.PProfListen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", httppprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+
+		go func() {
+			// Intentionally ignores the error: a failed debug listener
+			// shouldn't take down the build.
+			http.ListenAndServe(args.PProfListen, mux)
+		}()
+	}
+
 	srcDir := filepath.Dir(args.TopFile)
 
 	ninjaDeps := make([]string, 0)
@@ -148,12 +364,25 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 		}}
 	}
 
+	invocations = sortPrimaryBuilderInvocations(invocations)
+	invocations = resolvePrimaryBuilderInvocationDeps(invocations)
+	for i, invocation := range invocations {
+		invocations[i] = wrapCacheablePrimaryBuilderInvocation(invocation)
+	}
+
+	subninjas := args.Subninjas
+	if args.BuildGlobsNinjaFile != "" {
+		// build-globs.ninja is rewritten below from the globs recorded
+		// during this run, before ctx.WriteBuildFile writes the subninja
+		// statement that includes it.
+		subninjas = append(subninjas, args.BuildGlobsNinjaFile)
+	}
+
 	bootstrapConfig := &Config{
 		stage: stage,
 
 		topLevelBlueprintsFile:    args.TopFile,
-		subninjas:                 args.Subninjas,
-		globListDir:               args.GlobListDir,
+		subninjas:                 subninjas,
 		runGoTests:                args.RunGoTests,
 		useValidations:            args.UseValidations,
 		primaryBuilderInvocations: invocations,
@@ -165,9 +394,11 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 	ctx.RegisterModuleType("blueprint_go_binary", newGoBinaryModuleFactory(bootstrapConfig, true))
 	ctx.RegisterSingletonType("bootstrap", newSingletonFactory(bootstrapConfig))
 
-	ctx.RegisterSingletonType("glob", globSingletonFactory(bootstrapConfig.globListDir, ctx))
-
-	blueprintFiles, errs := ctx.ParseFileList(filepath.Dir(args.TopFile), filesToParse, config)
+	var blueprintFiles []string
+	var errs []error
+	traceRegion(args, "ParseFileList", func() {
+		blueprintFiles, errs = ctx.ParseFileList(filepath.Dir(args.TopFile), filesToParse, config)
+	})
 	if len(errs) > 0 {
 		fatalErrors(errs)
 	}
@@ -175,7 +406,10 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 	// Add extra ninja file dependencies
 	ninjaDeps = append(ninjaDeps, blueprintFiles...)
 
-	extraDeps, errs := ctx.ResolveDependencies(config)
+	var extraDeps []string
+	traceRegion(args, "ResolveDependencies", func() {
+		extraDeps, errs = ctx.ResolveDependencies(config)
+	})
 	if len(errs) > 0 {
 		fatalErrors(errs)
 	}
@@ -187,7 +421,9 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 		}
 	}
 
-	extraDeps, errs = ctx.PrepareBuildActions(config)
+	traceRegion(args, "PrepareBuildActions", func() {
+		extraDeps, errs = ctx.PrepareBuildActions(config)
+	})
 	if len(errs) > 0 {
 		fatalErrors(errs)
 	}
@@ -221,11 +457,30 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 		out = ioutil.Discard.(io.StringWriter)
 	}
 
-	if args.GlobFile != "" {
-		WriteBuildGlobsNinjaFile(args.GlobListDir, ctx, args, config)
+	globs := ctx.Globs()
+
+	globFileList := filepath.Join(ctx.SrcDir(), buildDir, "globs.json")
+	if err := glob.WriteFileList(globFileList, toGlobResults(globs)); err != nil {
+		fatalf("error writing %s: %s", globFileList, err)
+	}
+	ninjaDeps = append(ninjaDeps, globFileList)
+
+	if args.BuildGlobsNinjaFile != "" {
+		if err := writeBuildGlobsNinjaFile(globs, args.BuildGlobsNinjaFile, args.BpglobCmd); err != nil {
+			fatalf("error writing %s: %s", args.BuildGlobsNinjaFile, err)
+		}
+	}
+
+	if args.DocFile != "" {
+		if err := writeDocs(ctx, srcDir, args.DocFile); err != nil {
+			fatalf("error writing %s: %s", args.DocFile, err)
+		}
+		ninjaDeps = append(ninjaDeps, args.DocFile)
 	}
 
-	err = ctx.WriteBuildFile(out)
+	traceRegion(args, "WriteBuildFile", func() {
+		err = ctx.WriteBuildFile(out)
+	})
 	if err != nil {
 		fatalf("error writing Ninja file contents: %s", err)
 	}
@@ -261,35 +516,259 @@ func RunBlueprint(args Args, ctx *blueprint.Context, config interface{}) []strin
 		pprof.WriteHeapProfile(f)
 	}
 
+	writeNamedProfile(ctx, args.BlockProfile, "block")
+	writeNamedProfile(ctx, args.MutexProfile, "mutex")
+	writeNamedProfile(ctx, args.GoroutineProfile, "goroutine")
+
 	return ninjaDeps
 }
 
+// writeNamedProfile writes the named runtime/pprof profile (e.g. "block",
+// "mutex", "goroutine") to path, if path is non-empty.
+func writeNamedProfile(ctx *blueprint.Context, path, name string) {
+	if path == "" {
+		return
+	}
+
+	f, err := os.Create(joinPath(ctx.SrcDir(), path))
+	if err != nil {
+		fatalf("error opening %sprofile: %s", name, err)
+	}
+	defer f.Close()
+
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		fatalf("error writing %sprofile: %s", name, err)
+	}
+}
+
+// traceRegion runs fn, wrapped in a runtime/trace region named name when
+// Args.TraceRegions is set, so the execution trace is navigable by phase
+// instead of one opaque blob.
+func traceRegion(args Args, name string, fn func()) {
+	if !args.TraceRegions {
+		fn()
+		return
+	}
+
+	trace.WithRegion(context.Background(), name, fn)
+}
+
+const (
+	severityError    = "error"
+	severityInternal = "internal"
+)
+
+// errorRecord is the stable JSON schema fatalErrors emits in "json" error
+// format, one object per error.
+type errorRecord struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Property string `json:"property,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// errorFormat and errorLogWriter are set once, near the top of RunBlueprint,
+// from Args.ErrorFormat and Args.ErrorLogFile, and are consulted by every
+// later fatalf/fatalErrors call in this package.
+var (
+	errorFormat    = ErrorFormatText
+	errorLogWriter io.StringWriter
+)
+
+func initErrorReporting(ctx *blueprint.Context, args Args) {
+	if args.ErrorFormat != "" {
+		errorFormat = args.ErrorFormat
+	}
+
+	if args.ErrorLogFile != "" {
+		f, err := os.Create(joinPath(ctx.SrcDir(), args.ErrorLogFile))
+		if err != nil {
+			fatalf("error opening error log: %s", err)
+		}
+		errorLogWriter = f
+	}
+}
+
 func fatalf(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
-	fmt.Print("\n")
-	os.Exit(1)
+	fatalErrors([]error{fmt.Errorf(format, args...)})
 }
 
 func fatalErrors(errs []error) {
-	red := "\x1b[31m"
-	unred := "\x1b[0m"
-
+	records := make([]errorRecord, 0, len(errs))
 	for _, err := range errs {
-		switch err := err.(type) {
-		case *blueprint.BlueprintError,
-			*blueprint.ModuleError,
-			*blueprint.PropertyError:
-			fmt.Printf("%serror:%s %s\n", red, unred, err.Error())
-		default:
-			fmt.Printf("%sinternal error:%s %s\n", red, unred, err)
+		records = append(records, errorToRecord(err))
+	}
+
+	if errorLogWriter != nil {
+		for _, record := range records {
+			buf, err := json.Marshal(record)
+			if err == nil {
+				errorLogWriter.WriteString(string(buf) + "\n")
+			}
+		}
+	}
+
+	switch errorFormat {
+	case ErrorFormatJSON:
+		buf, err := json.MarshalIndent(records, "", "  ")
+		if err == nil {
+			fmt.Fprintln(os.Stderr, string(buf))
+		}
+	case ErrorFormatGithubActions:
+		for _, record := range records {
+			fmt.Printf("::error file=%s,line=%d,col=%d::%s\n",
+				record.File, record.Line, record.Column, record.Message)
+		}
+	default:
+		red := "\x1b[31m"
+		unred := "\x1b[0m"
+		for i, err := range errs {
+			if records[i].Severity == severityInternal {
+				fmt.Printf("%sinternal error:%s %s\n", red, unred, err)
+			} else {
+				fmt.Printf("%serror:%s %s\n", red, unred, err.Error())
+			}
 		}
 	}
+
 	os.Exit(1)
 }
 
+// errorToRecord extracts the stable fields out of the position-carrying
+// error types Blueprint produces, falling back to a bare message for
+// anything else (e.g. I/O errors from this package itself).
+func errorToRecord(err error) errorRecord {
+	switch e := err.(type) {
+	case *blueprint.PropertyError:
+		return errorRecord{
+			File:     e.Pos.Filename,
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Module:   e.Module,
+			Property: e.Property,
+			Severity: severityError,
+			Message:  e.Err.Error(),
+		}
+	case *blueprint.ModuleError:
+		return errorRecord{
+			File:     e.Pos.Filename,
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Module:   e.Module,
+			Severity: severityError,
+			Message:  e.Err.Error(),
+		}
+	case *blueprint.BlueprintError:
+		return errorRecord{
+			File:     e.Pos.Filename,
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Severity: severityError,
+			Message:  e.Err.Error(),
+		}
+	default:
+		// Not one of Blueprint's own position-carrying error types: this is
+		// an internal error (e.g. I/O failure) rather than a user-facing
+		// Blueprint file error, matching the pre-existing "internal error:"
+		// / "error:" distinction this package has always drawn.
+		return errorRecord{
+			Severity: severityInternal,
+			Message:  err.Error(),
+		}
+	}
+}
+
+// toGlobResults converts the globs the primary builder performed while
+// resolving dependencies and preparing build actions into the form recorded
+// in globs.json.
+func toGlobResults(globs []blueprint.GlobResult) glob.FileList {
+	results := make(glob.FileList, 0, len(globs))
+	for _, g := range globs {
+		results = append(results, glob.Result{
+			Pattern:  g.Pattern,
+			Excludes: g.Excludes,
+			Dir:      g.Dir,
+			Files:    g.Matches,
+		})
+	}
+	return results
+}
+
+// writeBuildGlobsNinjaFile emits a single bpglob rule plus one build
+// statement per recorded glob, each producing a stamp file under .glob/.
+// build.ninja includes this file via subninja, so that Ninja -- not a re-run
+// of the primary builder -- decides whether a glob needs to be re-expanded.
+func writeBuildGlobsNinjaFile(globs []blueprint.GlobResult, out string, bpglobCmd string) error {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "bpglobCmd = %s\n", bpglobCmd)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "rule bpglob")
+	fmt.Fprintln(buf, "  command = $bpglobCmd -o $out -d $globDir $globExcludes $globPattern")
+	fmt.Fprintln(buf, "  description = glob $globPattern")
+	// bpglob writes $out.d listing every directory it had to read to
+	// evaluate the pattern, so Ninja -- via its gcc-style depfile parsing --
+	// notices directory changes and reruns bpglob instead of trusting the
+	// stamp forever once it first exists.
+	fmt.Fprintln(buf, "  depfile = $out.d")
+	fmt.Fprintln(buf, "  deps = gcc")
+	fmt.Fprintln(buf)
+
+	for i, g := range globs {
+		stamp := fmt.Sprintf(".glob/%d.stamp", i)
+
+		fmt.Fprintf(buf, "build %s: bpglob\n", stamp)
+		fmt.Fprintf(buf, "  globPattern = %s\n", g.Pattern)
+		fmt.Fprintf(buf, "  globDir = %s\n", g.Dir)
+		for _, exclude := range g.Excludes {
+			fmt.Fprintf(buf, "  globExcludes = $globExcludes -e %s\n", exclude)
+		}
+		fmt.Fprintln(buf)
+	}
+
+	return ioutil.WriteFile(out, buf.Bytes(), 0666)
+}
+
 func joinPath(base, path string) string {
 	if filepath.IsAbs(path) {
 		return path
 	}
 	return filepath.Join(base, path)
 }
+
+// writeDocs finds the primary builder, walks its bootstrap_go_package
+// dependencies to collect their sources, and renders module-type reference
+// documentation for everything the primary builder registered.
+func writeDocs(ctx *blueprint.Context, srcDir string, docFile string) error {
+	var pkgFiles map[string][]string
+
+	ctx.VisitAllModulesIf(isBootstrapBinaryModule, func(module blueprint.Module) {
+		if binaryModule, ok := module.(*goBinaryModule); ok {
+			if binaryModule.properties.PrimaryBuilder || pkgFiles == nil {
+				pkgFiles = packageFiles(ctx, module, srcDir)
+			}
+		}
+	})
+
+	return bpdoc.Write(joinPath(ctx.SrcDir(), docFile), ctx.ModuleTypePropertyStructs(), pkgFiles)
+}
+
+// packageFiles walks the bootstrap_go_package dependencies of module depth
+// first, recording the package path and the (source-tree-relative) files
+// that belong to it.
+func packageFiles(ctx *blueprint.Context, module blueprint.Module, srcDir string) map[string][]string {
+	pkgFiles := make(map[string][]string)
+
+	ctx.VisitDepsDepthFirst(module, func(dep blueprint.Module) {
+		if pkg, ok := dep.(*goPackageModule); ok {
+			moduleDir := ctx.ModuleDir(dep)
+			pkgFiles[pkg.properties.PkgPath] = append(pkgFiles[pkg.properties.PkgPath],
+				PrefixPaths(pkg.properties.Srcs, filepath.Join(srcDir, moduleDir))...)
+		}
+	})
+
+	return pkgFiles
+}
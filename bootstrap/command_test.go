@@ -0,0 +1,128 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"text/scanner"
+
+	"github.com/google/blueprint"
+)
+
+func TestErrorToRecord(t *testing.T) {
+	blueprintErr := &blueprint.BlueprintError{
+		Err: errors.New("bad syntax"),
+		Pos: scanner.Position{Filename: "Android.bp", Line: 12, Column: 3},
+	}
+
+	record := errorToRecord(blueprintErr)
+
+	if record.Severity != severityError {
+		t.Errorf("Severity = %q, want %q", record.Severity, severityError)
+	}
+	if record.File != "Android.bp" || record.Line != 12 || record.Column != 3 {
+		t.Errorf("position = %s:%d:%d, want Android.bp:12:3", record.File, record.Line, record.Column)
+	}
+	if record.Message != "bad syntax" {
+		t.Errorf("Message = %q, want %q", record.Message, "bad syntax")
+	}
+
+	internalRecord := errorToRecord(errors.New("disk full"))
+	if internalRecord.Severity != severityInternal {
+		t.Errorf("Severity = %q, want %q for a non-Blueprint error", internalRecord.Severity, severityInternal)
+	}
+}
+
+func TestSortPrimaryBuilderInvocations(t *testing.T) {
+	invocations := []PrimaryBuilderInvocation{
+		{Name: "main", Deps: []string{"primary"}},
+		{Name: "primary", Deps: []string{"bootstrap"}},
+		{Name: "bootstrap"},
+	}
+
+	sorted := sortPrimaryBuilderInvocations(invocations)
+
+	var names []string
+	for _, invocation := range sorted {
+		names = append(names, invocation.Name)
+	}
+
+	want := []string{"bootstrap", "primary", "main"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("sortPrimaryBuilderInvocations() order = %v, want %v", names, want)
+	}
+}
+
+func TestResolvePrimaryBuilderInvocationDeps(t *testing.T) {
+	invocations := []PrimaryBuilderInvocation{
+		{Name: "bootstrap", Outputs: []string{"bootstrap.ninja"}},
+		{Name: "primary", Deps: []string{"bootstrap"}, Outputs: []string{"primary.ninja"}},
+	}
+
+	resolved := resolvePrimaryBuilderInvocationDeps(invocations)
+
+	want := []string{"bootstrap.ninja"}
+	if !reflect.DeepEqual(resolved[1].OrderOnlyInputs, want) {
+		t.Errorf("primary.OrderOnlyInputs = %v, want %v", resolved[1].OrderOnlyInputs, want)
+	}
+	if len(resolved[0].OrderOnlyInputs) != 0 {
+		t.Errorf("bootstrap.OrderOnlyInputs = %v, want empty", resolved[0].OrderOnlyInputs)
+	}
+}
+
+func TestWrapCacheablePrimaryBuilderInvocation(t *testing.T) {
+	invocation := PrimaryBuilderInvocation{
+		Args:           []string{"-o", "build.ninja"},
+		CacheKeyInputs: []string{"Android.bp"},
+		CacheDir:       "out/.cache",
+	}
+
+	wrapped := wrapCacheablePrimaryBuilderInvocation(invocation)
+
+	if wrapped.Command == nil {
+		t.Fatal("wrapped.Command = nil, want a bpcache-wrapped command")
+	}
+	if wrapped.Command[0] != "bpcache" {
+		t.Errorf("wrapped.Command[0] = %q, want \"bpcache\"", wrapped.Command[0])
+	}
+
+	var sawSeparator bool
+	for _, arg := range wrapped.Command {
+		if arg == "--" {
+			sawSeparator = true
+			break
+		}
+	}
+	if !sawSeparator {
+		t.Errorf("wrapped.Command = %v, want a \"--\" separator before the wrapped command", wrapped.Command)
+	}
+
+	// The original Args are left untouched; only Command is rewritten.
+	if !reflect.DeepEqual(wrapped.Args, invocation.Args) {
+		t.Errorf("wrapped.Args = %v, want unchanged %v", wrapped.Args, invocation.Args)
+	}
+}
+
+func TestWrapCacheablePrimaryBuilderInvocationNotCacheable(t *testing.T) {
+	invocation := PrimaryBuilderInvocation{Args: []string{"-o", "build.ninja"}}
+
+	wrapped := wrapCacheablePrimaryBuilderInvocation(invocation)
+
+	if wrapped.Command != nil {
+		t.Errorf("wrapped.Command = %v, want nil for a non-cacheable invocation", wrapped.Command)
+	}
+}
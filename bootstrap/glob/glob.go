@@ -0,0 +1,75 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package glob records the globs a primary builder performed while
+// generating build actions as a globs.json file list, and reads that list
+// back. It does not re-expand globs itself; bpglob does that from the
+// pattern it is given on its command line.
+package glob
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+// Result is the recorded outcome of a single glob performed by the primary
+// builder: the pattern and excludes it was asked for, the working directory
+// it was resolved relative to, and the file list it produced at that time.
+type Result struct {
+	Pattern  string   `json:"pattern"`
+	Excludes []string `json:"excludes,omitempty"`
+	Dir      string   `json:"dir"`
+	Files    []string `json:"files"`
+}
+
+// FileList is the set of every glob a primary builder run recorded, in the
+// order they were first performed.
+type FileList []Result
+
+// WriteFileList writes globs to path as indented JSON (globs.json), in the
+// form ReadFileList reads back.
+func WriteFileList(path string, globs FileList) error {
+	buf, err := json.MarshalIndent(globs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0666)
+}
+
+// ReadFileList reads back a globs.json previously written by WriteFileList.
+func ReadFileList(path string) (FileList, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var globs FileList
+	if err := json.Unmarshal(buf, &globs); err != nil {
+		return nil, err
+	}
+	return globs, nil
+}
+
+// FilesString returns Files joined in a stable, sorted, newline-separated
+// form suitable for writing to (and diffing against) a stamp file.
+func (r Result) FilesString() string {
+	files := append([]string(nil), r.Files...)
+	sort.Strings(files)
+
+	s := ""
+	for _, f := range files {
+		s += f + "\n"
+	}
+	return s
+}